@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+
+	"tekao.net/jnigi"
+)
+
+const DeclarationsPackage = GraphPackage + "/declarations"
+
+const NamespaceDeclarationClass = DeclarationsPackage + "/NamespaceDeclaration"
+const RecordDeclarationClass = DeclarationsPackage + "/RecordDeclaration"
+const FunctionDeclarationClass = DeclarationsPackage + "/FunctionDeclaration"
+
+// NamespaceDeclaration wraps a CPG NamespaceDeclaration node.
+type NamespaceDeclaration Node
+
+func (n *NamespaceDeclaration) ConvertToGo(o *jnigi.ObjectRef) error {
+	*n = (NamespaceDeclaration)(*o)
+	return nil
+}
+
+func (n *NamespaceDeclaration) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(n), nil
+}
+
+func (*NamespaceDeclaration) GetClassName() string {
+	return NamespaceDeclarationClass
+}
+
+func (*NamespaceDeclaration) IsArray() bool {
+	return false
+}
+
+// RecordDeclaration wraps a CPG RecordDeclaration node.
+type RecordDeclaration Node
+
+func (r *RecordDeclaration) ConvertToGo(o *jnigi.ObjectRef) error {
+	*r = (RecordDeclaration)(*o)
+	return nil
+}
+
+func (r *RecordDeclaration) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(r), nil
+}
+
+func (*RecordDeclaration) GetClassName() string {
+	return RecordDeclarationClass
+}
+
+func (*RecordDeclaration) IsArray() bool {
+	return false
+}
+
+// FunctionDeclaration wraps a CPG FunctionDeclaration node.
+type FunctionDeclaration Node
+
+func (f *FunctionDeclaration) ConvertToGo(o *jnigi.ObjectRef) error {
+	*f = (FunctionDeclaration)(*o)
+	return nil
+}
+
+func (f *FunctionDeclaration) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(f), nil
+}
+
+func (*FunctionDeclaration) GetClassName() string {
+	return FunctionDeclarationClass
+}
+
+func (*FunctionDeclaration) IsArray() bool {
+	return false
+}
+
+// qualifiedName prefixes name with ctx's package-prefix for importPath, so
+// that e.g. package "net/http"'s "Client" becomes "net_http.Client" instead
+// of the bare "Client" that collides with any other imported package's own
+// "Client". Packages that were never registered via AddPackage (and so
+// have no prefix) fall back to the bare name, matching the pre-multi-package
+// behavior.
+func qualifiedName(ctx *TranslationContext, importPath, name string) string {
+	prefix := ctx.PackagePrefix(importPath)
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// recordQualifiedName returns the fully qualified name TranslatePackage
+// assigns to the RecordDeclaration for typeSpec.
+func recordQualifiedName(ctx *TranslationContext, importPath string, typeSpec *ast.TypeSpec) string {
+	return qualifiedName(ctx, importPath, typeSpec.Name.Name)
+}
+
+// functionQualifiedName returns the fully qualified name TranslatePackage
+// assigns to the FunctionDeclaration for d. For a method, the receiver's
+// type name is folded in ahead of the method name (e.g. "Person.Greet"),
+// since otherwise two methods with the same name on different receiver
+// types in the same package - "func (p Person) Greet() string" and
+// "func (r Robot) Greet() string" - would both qualify to the bare
+// "<prefix>.Greet" and collide.
+func functionQualifiedName(ctx *TranslationContext, importPath string, d *ast.FuncDecl) string {
+	name := d.Name.Name
+	if d.Recv != nil && len(d.Recv.List) > 0 {
+		if recv := receiverTypeName(d.Recv.List[0].Type); recv != "" {
+			name = recv + "." + name
+		}
+	}
+	return qualifiedName(ctx, importPath, name)
+}
+
+// receiverTypeName returns the declared type name of a method receiver,
+// unwrapping a pointer receiver ("*Person" -> "Person").
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	default:
+		return ""
+	}
+}
+
+func newNode(env *jnigi.Env, class, name string) (*jnigi.ObjectRef, error) {
+	obj, err := env.NewObject(class)
+	if err != nil {
+		return nil, err
+	}
+
+	javaName, err := env.NewObject("java/lang/String", []byte(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.CallMethod(obj, "setName", jnigi.Void, javaName); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// TranslatePackage parses the files registered for importPath via
+// AddPackage, runs go/types resolution over them, and builds the
+// NamespaceDeclaration for the package together with one
+// RecordDeclaration per type declaration and one FunctionDeclaration per
+// function declaration, each named through qualifiedName so that the
+// resulting fully-qualified names are unique across every package added to
+// ctx. Function bodies are walked with handleExpr so that expression nodes
+// also carry go/types-resolved Type information when available.
+func (ctx *TranslationContext) TranslatePackage(env *jnigi.Env, importPath string) (*NamespaceDeclaration, error) {
+	fset := token.NewFileSet()
+
+	var files []*ast.File
+	for _, filename := range ctx.filesForPackage(importPath) {
+		file, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	// Only TypeResolutionStrict mode reports a resolution failure here; the
+	// package is then translated on the pure go/ast path, since TypeInfo
+	// holds no entry for the nodes of these freshly parsed files.
+	_, _ = ctx.Check(fset, importPath, files)
+
+	nsObj, err := newNode(env, NamespaceDeclarationClass, qualifiedName(ctx, importPath, importPath))
+	if err != nil {
+		return nil, err
+	}
+	namespace := (*NamespaceDeclaration)(nsObj)
+
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					typeSpec, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					recordObj, err := newNode(env, RecordDeclarationClass, recordQualifiedName(ctx, importPath, typeSpec))
+					if err != nil {
+						return nil, err
+					}
+					if _, err := env.CallMethod(nsObj, "addDeclaration", jnigi.Void, recordObj); err != nil {
+						return nil, err
+					}
+				}
+			case *ast.FuncDecl:
+				funcObj, err := newNode(env, FunctionDeclarationClass, functionQualifiedName(ctx, importPath, d))
+				if err != nil {
+					return nil, err
+				}
+				if d.Body != nil {
+					for _, stmt := range d.Body.List {
+						exprStmt, ok := stmt.(*ast.ExprStmt)
+						if !ok {
+							continue
+						}
+						exprObj, err := handleExpr(env, ctx, exprStmt.X)
+						if err != nil {
+							return nil, err
+						}
+						if exprObj == nil {
+							continue
+						}
+						if _, err := env.CallMethod(funcObj, "addStatement", jnigi.Void, exprObj); err != nil {
+							return nil, err
+						}
+					}
+				}
+				if _, err := env.CallMethod(nsObj, "addDeclaration", jnigi.Void, funcObj); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return namespace, nil
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"go/ast"
+	"go/types"
+
+	"tekao.net/jnigi"
+)
+
+const GraphPackage = CPGPackage + "/graph"
+const TypesPackage = GraphPackage + "/types"
+const ExpressionsPackage = GraphPackage + "/statements/expressions"
+
+const TypeClass = TypesPackage + "/Type"
+const DeclaredReferenceExpressionClass = ExpressionsPackage + "/DeclaredReferenceExpression"
+const MemberExpressionClass = ExpressionsPackage + "/MemberExpression"
+const CallExpressionClass = ExpressionsPackage + "/CallExpression"
+
+// Type wraps a CPG Type node.
+type Type Node
+
+func (t *Type) ConvertToGo(o *jnigi.ObjectRef) error {
+	*t = (Type)(*o)
+	return nil
+}
+
+func (t *Type) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(t), nil
+}
+
+func (*Type) GetClassName() string {
+	return TypeClass
+}
+
+func (*Type) IsArray() bool {
+	return false
+}
+
+// DeclaredReferenceExpression wraps a CPG DeclaredReferenceExpression node.
+type DeclaredReferenceExpression Node
+
+func (d *DeclaredReferenceExpression) ConvertToGo(o *jnigi.ObjectRef) error {
+	*d = (DeclaredReferenceExpression)(*o)
+	return nil
+}
+
+func (d *DeclaredReferenceExpression) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(d), nil
+}
+
+func (*DeclaredReferenceExpression) GetClassName() string {
+	return DeclaredReferenceExpressionClass
+}
+
+func (*DeclaredReferenceExpression) IsArray() bool {
+	return false
+}
+
+// MemberExpression wraps a CPG MemberExpression node.
+type MemberExpression Node
+
+func (m *MemberExpression) ConvertToGo(o *jnigi.ObjectRef) error {
+	*m = (MemberExpression)(*o)
+	return nil
+}
+
+func (m *MemberExpression) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(m), nil
+}
+
+func (*MemberExpression) GetClassName() string {
+	return MemberExpressionClass
+}
+
+func (*MemberExpression) IsArray() bool {
+	return false
+}
+
+// CallExpression wraps a CPG CallExpression node.
+type CallExpression Node
+
+func (c *CallExpression) ConvertToGo(o *jnigi.ObjectRef) error {
+	*c = (CallExpression)(*o)
+	return nil
+}
+
+func (c *CallExpression) ConvertToJava() (obj *jnigi.ObjectRef, err error) {
+	return (*jnigi.ObjectRef)(c), nil
+}
+
+func (*CallExpression) GetClassName() string {
+	return CallExpressionClass
+}
+
+func (*CallExpression) IsArray() bool {
+	return false
+}
+
+// newTypeNode creates the Java-side Type node for a resolved go/types.Type
+// and sets its readable name to goType.String(). goType may be one of the
+// opaque placeholders synthesized by stubImporter, in which case the name
+// is the placeholder's (e.g. "example.com/unavailable.Config" for a stub
+// type, "interface{}" for a stub value) rather than the real type's.
+func newTypeNode(env *jnigi.Env, goType types.Type) (*Type, error) {
+	obj, err := env.NewObject(TypeClass)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := env.NewObject("java/lang/String", []byte(goType.String()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.CallMethod(obj, "setName", jnigi.Void, name); err != nil {
+		return nil, err
+	}
+
+	return (*Type)(obj), nil
+}
+
+// attachType resolves goType to a CPG Type node and sets it on node via the
+// Java-side setType method shared by expression nodes.
+func attachType(env *jnigi.Env, node *jnigi.ObjectRef, goType types.Type) error {
+	if goType == nil {
+		return nil
+	}
+
+	typeNode, err := newTypeNode(env, goType)
+	if err != nil {
+		return err
+	}
+	_, err = env.CallMethod(node, "setType", jnigi.Void, (*jnigi.ObjectRef)(typeNode))
+	return err
+}
+
+// resolveExprType returns expr's statically resolved type using info, or
+// nil if info is unavailable or expr's type could not be determined. Only
+// *ast.Ident, *ast.SelectorExpr and *ast.CallExpr are looked up; any other
+// expression (e.g. a literal) yields nil even if info.Types records it. It
+// factors out the lookup that handleIdent/handleSelectorExpr/handleCallExpr
+// each perform before calling attachType, so the resolution logic itself can
+// be unit-tested without a live JNI environment.
+func resolveExprType(info *types.Info, expr ast.Expr) types.Type {
+	if info == nil {
+		return nil
+	}
+
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if obj := info.Uses[e]; obj != nil {
+			return obj.Type()
+		}
+		if obj := info.Defs[e]; obj != nil {
+			return obj.Type()
+		}
+	case *ast.SelectorExpr:
+		if selection, ok := info.Selections[e]; ok {
+			return selection.Type()
+		}
+		if tv, ok := info.Types[e]; ok {
+			return tv.Type
+		}
+	case *ast.CallExpr:
+		if tv, ok := info.Types[e]; ok {
+			return tv.Type
+		}
+	}
+
+	return nil
+}
+
+// handleExpr dispatches expr to the matching CPG expression handler and, if
+// ctx has a *types.Info available from a prior TranslationContext.Check
+// call, resolves and attaches expr's static type to the resulting node.
+// Unlike the pure go/ast path, the Type set on the returned node may come
+// from a stubImporter placeholder when expr refers to a package that
+// couldn't be fully resolved, rather than being left unset.
+//
+// *ast.CallExpr is handled explicitly rather than falling through to
+// default: per the Go spec, a bare expression statement is only legal as a
+// call (or a channel receive), so every statement handleExpr is invoked on
+// from TranslatePackage's function-body walk is a *ast.CallExpr in
+// practice. Without this case, the go/types wiring below never fired on
+// realistic code such as "fmt.Println(...)" or "obj.Method()".
+func handleExpr(env *jnigi.Env, ctx *TranslationContext, expr ast.Expr) (*jnigi.ObjectRef, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		node, err := handleIdent(env, ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		return (*jnigi.ObjectRef)(node), nil
+	case *ast.SelectorExpr:
+		node, err := handleSelectorExpr(env, ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		return (*jnigi.ObjectRef)(node), nil
+	case *ast.CallExpr:
+		node, err := handleCallExpr(env, ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		return (*jnigi.ObjectRef)(node), nil
+	default:
+		return nil, nil
+	}
+}
+
+// handleIdent builds a DeclaredReferenceExpression for ident and, when
+// go/types info is available on ctx, resolves its type from info.Uses (a
+// reference to an existing declaration) or info.Defs (the declaration
+// itself) and attaches it via attachType. This is what makes the resolution
+// pass added to TranslationContext.Check observable in the CPG: without
+// this call site, Check's result was never consumed.
+func handleIdent(env *jnigi.Env, ctx *TranslationContext, ident *ast.Ident) (*DeclaredReferenceExpression, error) {
+	name, err := env.NewObject("java/lang/String", []byte(ident.Name))
+	if err != nil {
+		return nil, err
+	}
+	obj, err := env.NewObject(DeclaredReferenceExpressionClass)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.CallMethod(obj, "setName", jnigi.Void, name); err != nil {
+		return nil, err
+	}
+
+	node := (*DeclaredReferenceExpression)(obj)
+
+	if goType := resolveExprType(ctx.TypeInfo(), ident); goType != nil {
+		if err := attachType(env, obj, goType); err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+// handleSelectorExpr builds a MemberExpression for a qualified expression
+// such as pkg.Ident or recv.Field and, when go/types info is available on
+// ctx, resolves its type from info.Selections (field/method accesses) or
+// falls back to the static type of the selector expression itself as
+// recorded in info.Types (e.g. a package-qualified identifier).
+func handleSelectorExpr(env *jnigi.Env, ctx *TranslationContext, sel *ast.SelectorExpr) (*MemberExpression, error) {
+	name, err := env.NewObject("java/lang/String", []byte(sel.Sel.Name))
+	if err != nil {
+		return nil, err
+	}
+	obj, err := env.NewObject(MemberExpressionClass)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.CallMethod(obj, "setName", jnigi.Void, name); err != nil {
+		return nil, err
+	}
+
+	node := (*MemberExpression)(obj)
+
+	if goType := resolveExprType(ctx.TypeInfo(), sel); goType != nil {
+		if err := attachType(env, obj, goType); err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+// handleCallExpr builds a CallExpression for call, recursing into call.Fun
+// to resolve the callee (itself a DeclaredReferenceExpression or
+// MemberExpression carrying its own resolved type, e.g. a *types.Signature)
+// and into each of call.Args so that arguments get their types resolved
+// too. Arguments that handleExpr does not handle (anything other than an
+// identifier, selector or call, e.g. a literal) produce no node and are not
+// added. When go/types info is available on ctx, the call expression's own
+// result type is resolved from info.Types and attached via attachType.
+func handleCallExpr(env *jnigi.Env, ctx *TranslationContext, call *ast.CallExpr) (*CallExpression, error) {
+	calleeObj, err := handleExpr(env, ctx, call.Fun)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := env.NewObject("java/lang/String", []byte(calleeName(call.Fun)))
+	if err != nil {
+		return nil, err
+	}
+	obj, err := env.NewObject(CallExpressionClass)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.CallMethod(obj, "setName", jnigi.Void, name); err != nil {
+		return nil, err
+	}
+
+	if calleeObj != nil {
+		if _, err := env.CallMethod(obj, "setCallee", jnigi.Void, calleeObj); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, arg := range call.Args {
+		argObj, err := handleExpr(env, ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		if argObj == nil {
+			continue
+		}
+		if _, err := env.CallMethod(obj, "addArgument", jnigi.Void, argObj); err != nil {
+			return nil, err
+		}
+	}
+
+	if goType := resolveExprType(ctx.TypeInfo(), call); goType != nil {
+		if err := attachType(env, obj, goType); err != nil {
+			return nil, err
+		}
+	}
+
+	return (*CallExpression)(obj), nil
+}
+
+// calleeName returns the readable name of a call's callee expression, e.g.
+// "Println" for both "Println(...)" and "fmt.Println(...)".
+func calleeName(fun ast.Expr) string {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return f.Name
+	case *ast.SelectorExpr:
+		return f.Sel.Name
+	default:
+		return ""
+	}
+}
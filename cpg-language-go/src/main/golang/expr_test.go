@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// TestResolveExprTypeOnCallStatement parses a function body shaped exactly
+// like what TranslatePackage walks (a *ast.FuncDecl whose body is a single
+// *ast.ExprStmt), which per the Go spec is always a call or a channel
+// receive. It asserts that resolveExprType - the lookup handleExpr's
+// *ast.CallExpr case relies on - actually resolves types for the call, its
+// callee, and its argument, instead of only ever seeing bare
+// *ast.Ident/*ast.SelectorExpr nodes that never occur at statement
+// position in real code.
+func TestResolveExprTypeOnCallStatement(t *testing.T) {
+	const src = `package main
+
+func greet(name string) string {
+	return name
+}
+
+func use() {
+	greet("a")
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "use.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{}
+	if _, err := conf.Check("main", fset, []*ast.File{file}, info); err != nil {
+		t.Fatalf("type-check: %v", err)
+	}
+
+	var call *ast.CallExpr
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "use" {
+			continue
+		}
+		stmt, ok := fn.Body.List[0].(*ast.ExprStmt)
+		if !ok {
+			t.Fatalf("use()'s body statement is %T, want *ast.ExprStmt", fn.Body.List[0])
+		}
+		call, ok = stmt.X.(*ast.CallExpr)
+		if !ok {
+			t.Fatalf("use()'s expression statement is %T, want *ast.CallExpr", stmt.X)
+		}
+	}
+	if call == nil {
+		t.Fatal("did not find use()'s call statement")
+	}
+
+	if got := resolveExprType(info, call); got == nil || got.String() != "string" {
+		t.Errorf("resolveExprType(call) = %v, want \"string\"", got)
+	}
+
+	callee, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		t.Fatalf("call.Fun is %T, want *ast.Ident", call.Fun)
+	}
+	calleeType := resolveExprType(info, callee)
+	if _, ok := calleeType.(*types.Signature); !ok {
+		t.Errorf("resolveExprType(callee) = %T, want *types.Signature", calleeType)
+	}
+
+	if len(call.Args) != 1 {
+		t.Fatalf("call has %d args, want 1", len(call.Args))
+	}
+	if got := resolveExprType(info, call.Args[0]); got != nil {
+		t.Errorf("resolveExprType(string literal arg) = %v, want nil (no Ident/SelectorExpr/CallExpr to resolve)", got)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tekao.net/jnigi"
+)
+
+// goPackage is one build package added to a TranslationContext via
+// AddPackage: its Go import path together with the source files that make
+// it up.
+type goPackage struct {
+	importPath string
+	files      []string
+}
+
+// multiPackageState tracks the packages added to a TranslationContext and
+// the package-prefix each one was assigned. Like typeCheckState, it lives
+// in a side table keyed by the TranslationContext pointer rather than as a
+// field on TranslationContext, since that type is declared outside of this
+// chunk.
+type multiPackageState struct {
+	packages []*goPackage
+	prefixes map[string]string // import path -> prefix
+}
+
+var (
+	multiPackageMu    sync.Mutex
+	multiPackageByCtx = map[*TranslationContext]*multiPackageState{}
+)
+
+// AddPackage registers a Go build package with a TranslationContext. Call
+// it once per package before translation; it recomputes the package-prefix
+// assignment for every package added so far, so that two packages sharing
+// a leaf name (e.g. "mypkg/util" and "otherpkg/util") still end up with
+// distinct, stable prefixes.
+//
+// The first call to AddPackage switches the TranslationContext into
+// multi-package mode. TranslateSinglePackage remains a thin wrapper that
+// calls AddPackage once and then translates, so single-package callers are
+// unaffected.
+func (ctx *TranslationContext) AddPackage(importPath string, files ...string) {
+	multiPackageMu.Lock()
+	defer multiPackageMu.Unlock()
+
+	state := multiPackageByCtx[ctx]
+	if state == nil {
+		state = &multiPackageState{}
+		multiPackageByCtx[ctx] = state
+	}
+
+	for _, pkg := range state.packages {
+		if pkg.importPath == importPath {
+			pkg.files = append(pkg.files, files...)
+			state.prefixes = assignPackagePrefixes(state.packages)
+			return
+		}
+	}
+
+	state.packages = append(state.packages, &goPackage{importPath: importPath, files: files})
+	state.prefixes = assignPackagePrefixes(state.packages)
+}
+
+// PackagePrefix returns the stable name-prefix computed for importPath,
+// e.g. "net_http" for "net/http". The prefix is threaded through
+// NamespaceDeclaration/RecordDeclaration/FunctionDeclaration name
+// construction so that fully-qualified names stay unique across every
+// package added to ctx. It returns the empty string if importPath was
+// never passed to AddPackage.
+func (ctx *TranslationContext) PackagePrefix(importPath string) string {
+	multiPackageMu.Lock()
+	defer multiPackageMu.Unlock()
+
+	state := multiPackageByCtx[ctx]
+	if state == nil {
+		return ""
+	}
+	return state.prefixes[importPath]
+}
+
+// releaseMultiPackageState drops the package/prefix bookkeeping AddPackage
+// accumulated for ctx. It is called from TranslationContext.Close so that a
+// finished translation doesn't keep ctx's entry in multiPackageByCtx alive
+// for the rest of the process.
+func releaseMultiPackageState(ctx *TranslationContext) {
+	multiPackageMu.Lock()
+	delete(multiPackageByCtx, ctx)
+	multiPackageMu.Unlock()
+}
+
+// filesForPackage returns the filenames registered for importPath via
+// AddPackage, or nil if importPath was never added.
+func (ctx *TranslationContext) filesForPackage(importPath string) []string {
+	multiPackageMu.Lock()
+	defer multiPackageMu.Unlock()
+
+	state := multiPackageByCtx[ctx]
+	if state == nil {
+		return nil
+	}
+	for _, pkg := range state.packages {
+		if pkg.importPath == importPath {
+			return pkg.files
+		}
+	}
+	return nil
+}
+
+// TranslateSinglePackage is the original single-translation-unit
+// entrypoint, kept for callers that only ever analyze one package. It is
+// now a thin wrapper around TranslatePackage, the multi-package path: it
+// registers importPath as the only package and then translates it, so a
+// lone package still gets a deterministic prefix rather than a flat,
+// unprefixed name.
+func (ctx *TranslationContext) TranslateSinglePackage(env *jnigi.Env, importPath string, files ...string) (*NamespaceDeclaration, error) {
+	ctx.AddPackage(importPath, files...)
+	return ctx.TranslatePackage(env, importPath)
+}
+
+// assignPackagePrefixes computes a stable prefix per package from its
+// import path, e.g. "net/http" -> "net_http". Two packages merely sharing a
+// leaf name, like "foo/util" and "bar/util", already get distinct prefixes
+// ("foo_util" and "bar_util") this way and are left alone. The collision
+// that actually needs disambiguating is two distinct import paths that
+// compute the *same* prefix (e.g. "a/b" and "a_b" both becoming "a_b"
+// after "/" is replaced with "_"); each package sharing a prefix is
+// suffixed with a 1-based index in import-path sort order, e.g.
+// "a_b#1", "a_b#2", so that fully qualified names built from the prefix
+// stay unique across the whole analyzed module.
+func assignPackagePrefixes(packages []*goPackage) map[string]string {
+	sorted := make([]*goPackage, len(packages))
+	copy(sorted, packages)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].importPath < sorted[j].importPath
+	})
+
+	basePrefix := make(map[string]string, len(sorted))
+	prefixCount := make(map[string]int)
+	for _, pkg := range sorted {
+		base := strings.ReplaceAll(pkg.importPath, "/", "_")
+		basePrefix[pkg.importPath] = base
+		prefixCount[base]++
+	}
+
+	seen := make(map[string]int)
+	prefixes := make(map[string]string, len(sorted))
+	for _, pkg := range sorted {
+		base := basePrefix[pkg.importPath]
+		if prefixCount[base] > 1 {
+			seen[base]++
+			prefixes[pkg.importPath] = base + "#" + strconv.Itoa(seen[base])
+			continue
+		}
+		prefixes[pkg.importPath] = base
+	}
+	return prefixes
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// TestAssignPackagePrefixesDisambiguatesOnComputedPrefix checks that the
+// "#N" suffix is applied to packages whose computed prefixes actually
+// collide ("a/b" and "a_b" both become "a_b"), and not to packages that
+// merely share a leaf name ("foo/util" and "bar/util" stay distinct once
+// their full import path is folded into the prefix).
+func TestAssignPackagePrefixesDisambiguatesOnComputedPrefix(t *testing.T) {
+	prefixes := assignPackagePrefixes([]*goPackage{
+		{importPath: "foo/util"},
+		{importPath: "bar/util"},
+		{importPath: "a/b"},
+		{importPath: "a_b"},
+	})
+
+	if prefixes["foo/util"] != "foo_util" {
+		t.Errorf(`prefixes["foo/util"] = %q, want "foo_util"`, prefixes["foo/util"])
+	}
+	if prefixes["bar/util"] != "bar_util" {
+		t.Errorf(`prefixes["bar/util"] = %q, want "bar_util"`, prefixes["bar/util"])
+	}
+
+	if prefixes["a/b"] == prefixes["a_b"] {
+		t.Errorf("prefixes for colliding import paths %q and %q must differ, both got %q",
+			"a/b", "a_b", prefixes["a/b"])
+	}
+	for _, importPath := range []string{"a/b", "a_b"} {
+		if prefixes[importPath] == "a_b" {
+			t.Errorf("prefixes[%q] = %q, want a disambiguated suffix", importPath, prefixes[importPath])
+		}
+	}
+}
+
+// TestQualifiedNamesCrossPackageReference exercises the scenario the
+// request calls out explicitly: an interface declared in one package,
+// implemented by a type in another. It registers both packages on a
+// TranslationContext and drives recordQualifiedName/functionQualifiedName -
+// the exact name-construction logic TranslatePackage calls while building
+// RecordDeclaration/FunctionDeclaration nodes - to assert the names it
+// actually produces are prefixed and unique across the two packages,
+// rather than re-deriving the same conclusion from go/types directly.
+func TestQualifiedNamesCrossPackageReference(t *testing.T) {
+	const greeterSrc = `package greeter
+
+type Greeter interface {
+	Greet() string
+}
+`
+	const personSrc = `package person
+
+type Person struct{}
+
+func (p Person) Greet() string {
+	return "hi"
+}
+`
+
+	fset := token.NewFileSet()
+	greeterFile, err := parser.ParseFile(fset, "greeter.go", greeterSrc, 0)
+	if err != nil {
+		t.Fatalf("ParseFile(greeter): %v", err)
+	}
+	personFile, err := parser.ParseFile(fset, "person.go", personSrc, 0)
+	if err != nil {
+		t.Fatalf("ParseFile(person): %v", err)
+	}
+
+	ctx := new(TranslationContext)
+	ctx.AddPackage("example.com/greeter", "greeter.go")
+	ctx.AddPackage("example.com/person", "person.go")
+
+	greeterType := findTypeSpec(t, greeterFile, "Greeter")
+	personType := findTypeSpec(t, personFile, "Person")
+	personGreet := findFuncDecl(t, personFile, "Greet")
+
+	greeterName := recordQualifiedName(ctx, "example.com/greeter", greeterType)
+	personName := recordQualifiedName(ctx, "example.com/person", personType)
+	greetName := functionQualifiedName(ctx, "example.com/person", personGreet)
+
+	if greeterName == "" || personName == "" {
+		t.Fatalf("expected non-empty qualified names, got greeter=%q person=%q", greeterName, personName)
+	}
+	if greeterName == personName {
+		t.Fatalf("expected distinct qualified names across packages, both got %q", greeterName)
+	}
+	if greeterName == "Greeter" || personName == "Person" {
+		t.Fatalf("expected qualified names to carry a package prefix, got greeter=%q person=%q", greeterName, personName)
+	}
+	wantGreetSuffix := "Person.Greet"
+	if len(greetName) < len(wantGreetSuffix) || greetName[len(greetName)-len(wantGreetSuffix):] != wantGreetSuffix {
+		t.Errorf("functionQualifiedName(Person.Greet) = %q, want it to end with %q", greetName, wantGreetSuffix)
+	}
+}
+
+// TestFunctionQualifiedNameDisambiguatesMethodsBySameName is the same-package
+// collision the request's prefixing exists to avoid: two receiver types in
+// one package that each declare a method with the same name.
+func TestFunctionQualifiedNameDisambiguatesMethodsBySameName(t *testing.T) {
+	const src = `package animal
+
+type Person struct{}
+
+func (p Person) Greet() string {
+	return "hi"
+}
+
+type Robot struct{}
+
+func (r Robot) Greet() string {
+	return "BEEP"
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "animal.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	ctx := new(TranslationContext)
+	ctx.AddPackage("example.com/animal", "animal.go")
+
+	personGreet := functionQualifiedName(ctx, "example.com/animal", findFuncDecl(t, file, "Greet"))
+	robotGreet := functionQualifiedName(ctx, "example.com/animal", findFuncDeclOnRecv(t, file, "Greet", "Robot"))
+
+	if personGreet == robotGreet {
+		t.Errorf("expected distinct qualified names for same-named methods on different receivers, both got %q", personGreet)
+	}
+}
+
+func findTypeSpec(t *testing.T, file *ast.File, name string) *ast.TypeSpec {
+	t.Helper()
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if ok && typeSpec.Name.Name == name {
+				return typeSpec
+			}
+		}
+	}
+	t.Fatalf("type %q not found in %s", name, file.Name.Name)
+	return nil
+}
+
+func findFuncDecl(t *testing.T, file *ast.File, name string) *ast.FuncDecl {
+	t.Helper()
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if ok && funcDecl.Name.Name == name {
+			return funcDecl
+		}
+	}
+	t.Fatalf("func %q not found in %s", name, file.Name.Name)
+	return nil
+}
+
+func findFuncDeclOnRecv(t *testing.T, file *ast.File, name, recv string) *ast.FuncDecl {
+	t.Helper()
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Name.Name != name || funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+			continue
+		}
+		if receiverTypeName(funcDecl.Recv.List[0].Type) == recv {
+			return funcDecl
+		}
+	}
+	t.Fatalf("func %q on receiver %q not found in %s", name, recv, file.Name.Name)
+	return nil
+}
@@ -0,0 +1,376 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"sync"
+)
+
+// TypeResolutionMode controls how strictly the go/types checker deals with
+// packages that cannot be fully resolved on the host running the frontend.
+type TypeResolutionMode int
+
+const (
+	// TypeResolutionStrict requires every imported package to resolve
+	// through the real importer. A failure aborts type-checking and the
+	// frontend falls back to the pure go/ast path for the whole
+	// translation unit.
+	TypeResolutionStrict TypeResolutionMode = iota
+
+	// TypeResolutionLenient tolerates imports that cannot be resolved on
+	// this host. Unresolvable packages are backed by a stubImporter
+	// so that go/types can still produce best-effort *types.Info for the
+	// parts of the AST that do resolve.
+	TypeResolutionLenient
+)
+
+// typeCheckState holds the per-TranslationContext type-checking results.
+// TranslationContext itself is defined outside of this chunk, so rather than
+// adding fields to it directly, state is tracked in this side table and keyed
+// by the TranslationContext pointer, the same way the jnigi object refs are
+// keyed elsewhere in this frontend.
+type typeCheckState struct {
+	mode TypeResolutionMode
+	info *types.Info
+}
+
+var (
+	typeCheckMu    sync.Mutex
+	typeCheckByCtx = map[*TranslationContext]*typeCheckState{}
+)
+
+// Close releases the state this file and multipkg.go retain for ctx (the
+// *types.Info produced by Check, which pins every ast.Expr/*ast.Ident it
+// resolved, and the package/prefix bookkeeping from AddPackage). Call it
+// once translation for ctx has finished; a long-running process that
+// creates many TranslationContexts but never calls Close leaks one
+// typeCheckState/multiPackageState per context for the life of the
+// process.
+func (ctx *TranslationContext) Close() {
+	typeCheckMu.Lock()
+	delete(typeCheckByCtx, ctx)
+	typeCheckMu.Unlock()
+
+	releaseMultiPackageState(ctx)
+}
+
+// SetTypeResolutionMode selects strict or lenient go/types resolution for a
+// TranslationContext. It must be called before Check. A TranslationContext
+// on which it is never called is checked in TypeResolutionLenient mode;
+// there is no mode that skips the go/types pass, since TranslatePackage
+// always runs Check. handleExpr/handleIdent leave a node's Type unset only
+// where TypeInfo holds no entry for its expression.
+func (ctx *TranslationContext) SetTypeResolutionMode(mode TypeResolutionMode) {
+	typeCheckMu.Lock()
+	defer typeCheckMu.Unlock()
+
+	state := typeCheckByCtx[ctx]
+	if state == nil {
+		state = &typeCheckState{}
+		typeCheckByCtx[ctx] = state
+	}
+	state.mode = mode
+}
+
+// TypeInfo returns the *types.Info computed by the most recent call to
+// Check, or nil if Check has not been run yet for this TranslationContext.
+func (ctx *TranslationContext) TypeInfo() *types.Info {
+	typeCheckMu.Lock()
+	defer typeCheckMu.Unlock()
+
+	state := typeCheckByCtx[ctx]
+	if state == nil {
+		return nil
+	}
+	return state.info
+}
+
+// Check runs a go/types pass over files belonging to a single package and
+// records the resulting *types.Info on ctx for later lookup from
+// handleExpr/handleIdent. In TypeResolutionStrict mode a resolution failure
+// is returned to the caller, which is expected to fall back to the
+// pure-AST path. In TypeResolutionLenient mode (the default), unresolvable
+// imports are served by a stubImporter instead of failing the whole pass.
+func (ctx *TranslationContext) Check(fset *token.FileSet, pkgPath string, files []*ast.File) (*types.Info, error) {
+	typeCheckMu.Lock()
+	mode := TypeResolutionLenient
+	if state := typeCheckByCtx[ctx]; state != nil {
+		mode = state.mode
+	}
+	typeCheckMu.Unlock()
+
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+
+	var imp types.Importer
+	switch mode {
+	case TypeResolutionStrict:
+		imp = importer.Default()
+	default:
+		imp = newStubImporter(fset, files)
+	}
+
+	conf := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			// types.Config.Error is called for every soft error
+			// encountered during Check; swallowing them here is what
+			// makes lenient mode "best effort" instead of aborting
+			// on the first unresolved reference.
+		},
+	}
+	if mode == TypeResolutionStrict {
+		conf.Error = nil
+	}
+
+	pkg, err := conf.Check(pkgPath, fset, files, info)
+	if mode == TypeResolutionStrict && err != nil {
+		return nil, err
+	}
+	_ = pkg
+
+	typeCheckMu.Lock()
+	state := typeCheckByCtx[ctx]
+	if state == nil {
+		state = &typeCheckState{mode: mode}
+		typeCheckByCtx[ctx] = state
+	}
+	state.info = info
+	typeCheckMu.Unlock()
+
+	return info, nil
+}
+
+// stubImporter is a types.Importer that is used in TypeResolutionLenient
+// mode for import paths the real importer cannot resolve (typically
+// because the dependency's sources or export data are not available on
+// this host). Rather than failing the whole package, it synthesizes a
+// *types.Package whose Scope is populated on demand with opaque
+// TypeName/Var/Func objects named after the qualified identifiers that are
+// actually referenced from the given files, so that handleExpr/handleIdent
+// still get a non-nil, if imprecise, types.Object to attach to CPG nodes.
+type stubImporter struct {
+	fset     *token.FileSet
+	real     types.Importer
+	files    []*ast.File
+	packages map[string]*types.Package
+}
+
+func newStubImporter(fset *token.FileSet, files []*ast.File) *stubImporter {
+	return &stubImporter{
+		fset:     fset,
+		real:     importer.Default(),
+		files:    files,
+		packages: make(map[string]*types.Package),
+	}
+}
+
+// Import implements types.Importer.
+func (s *stubImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := s.packages[path]; ok {
+		return pkg, nil
+	}
+
+	if pkg, err := s.real.Import(path); err == nil {
+		s.packages[path] = pkg
+		return pkg, nil
+	}
+
+	pkg := s.synthesizePackage(path)
+	s.packages[path] = pkg
+	return pkg, nil
+}
+
+// synthesizePackage builds a permissive stand-in for an import path that
+// could not be resolved on this host. Its name is the last path segment
+// and its Scope is populated with one opaque object per qualified
+// identifier of the form <alias>.<Ident> found in s.files, where <alias>
+// is the local name the package would be bound to.
+func (s *stubImporter) synthesizePackage(path string) *types.Package {
+	name := path
+	if idx := lastSlash(path); idx >= 0 {
+		name = path[idx+1:]
+	}
+
+	pkg := types.NewPackage(path, name)
+	scope := pkg.Scope()
+
+	alias := localImportName(s.files, path, name)
+	for _, ref := range selectorIdentsFor(s.files, alias) {
+		if scope.Lookup(ref.ident.Name) != nil {
+			continue
+		}
+		scope.Insert(stubObjectFor(pkg, ref))
+	}
+
+	pkg.MarkComplete()
+	return pkg
+}
+
+// stubObjectFor guesses the kind of object a qualified identifier refers
+// to from its syntactic position (call expression, type position, or
+// plain value expression) and returns an opaque placeholder of that kind.
+// The placeholder's type carries no real information beyond "some type",
+// "some function" or "some value" since the real declaration is
+// unavailable; this is enough for handleExpr/handleIdent to build a CPG
+// node instead of leaving the reference completely unresolved.
+func stubObjectFor(pkg *types.Package, ref *identRef) types.Object {
+	empty := types.NewInterfaceType(nil, nil)
+	empty.Complete()
+
+	switch ref.kind {
+	case identKindType:
+		named := types.NewNamed(types.NewTypeName(token.NoPos, pkg, ref.ident.Name, nil), empty, nil)
+		return named.Obj()
+	case identKindFunc:
+		args := types.NewVar(token.NoPos, pkg, "args", types.NewSlice(empty))
+		sig := types.NewSignatureType(nil, nil, nil, types.NewTuple(args), nil, true)
+		return types.NewFunc(token.NoPos, pkg, ref.ident.Name, sig)
+	default:
+		return types.NewVar(token.NoPos, pkg, ref.ident.Name, empty)
+	}
+}
+
+type identKind int
+
+const (
+	identKindValue identKind = iota
+	identKindType
+	identKindFunc
+)
+
+type identRef struct {
+	ident *ast.Ident
+	kind  identKind
+}
+
+// selectorIdentsFor walks files looking for selector expressions of the
+// form alias.Ident and classifies each one by how it is used at that call
+// site (as a call target, a type, or a plain value).
+func selectorIdentsFor(files []*ast.File, alias string) []*identRef {
+	var refs []*identRef
+	if alias == "" {
+		return refs
+	}
+
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := sel.X.(*ast.Ident)
+			if !ok || ident.Name != alias {
+				return true
+			}
+			refs = append(refs, &identRef{ident: sel.Sel, kind: identKindValue})
+			return true
+		})
+	}
+
+	// A second pass classifies each reference by its parent node, since
+	// ast.Inspect visits parents before children and we need the parent
+	// of the *ast.SelectorExpr itself.
+	byIdent := make(map[*ast.Ident]*identRef)
+	for _, ref := range refs {
+		byIdent[ref.ident] = ref
+	}
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.CallExpr:
+				if sel, ok := node.Fun.(*ast.SelectorExpr); ok {
+					if ref, ok := byIdent[sel.Sel]; ok {
+						ref.kind = identKindFunc
+					}
+				}
+			case *ast.Field:
+				if sel, ok := node.Type.(*ast.SelectorExpr); ok {
+					if ref, ok := byIdent[sel.Sel]; ok {
+						ref.kind = identKindType
+					}
+				}
+			case *ast.ValueSpec:
+				if sel, ok := node.Type.(*ast.SelectorExpr); ok {
+					if ref, ok := byIdent[sel.Sel]; ok {
+						ref.kind = identKindType
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	return refs
+}
+
+// localImportName returns the local identifier a package is bound to in
+// files, honoring explicit import aliases and falling back to the
+// package's own name otherwise.
+func localImportName(files []*ast.File, path, name string) string {
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			importPath := importPathOf(imp)
+			if importPath != path {
+				continue
+			}
+			if imp.Name != nil {
+				return imp.Name.Name
+			}
+			return name
+		}
+	}
+	return name
+}
+
+func importPathOf(imp *ast.ImportSpec) string {
+	if imp.Path == nil {
+		return ""
+	}
+	// imp.Path.Value is a quoted string literal, e.g. "\"net/http\"".
+	v := imp.Path.Value
+	if len(v) >= 2 {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+func lastSlash(s string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == '/' {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2021, Fraunhofer AISEC. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ *                    $$$$$$\  $$$$$$$\   $$$$$$\
+ *                   $$  __$$\ $$  __$$\ $$  __$$\
+ *                   $$ /  \__|$$ |  $$ |$$ /  \__|
+ *                   $$ |      $$$$$$$  |$$ |$$$$\
+ *                   $$ |      $$  ____/ $$ |\_$$ |
+ *                   $$ |  $$\ $$ |      $$ |  $$ |
+ *                   \$$$$$   |$$ |      \$$$$$   |
+ *                    \______/ \__|       \______/
+ *
+ */
+package cpg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// TestStubImporterClassifiesIdentifierKinds exercises the lenient-mode
+// classification that stubImporter.synthesizePackage relies on when a
+// package's sources aren't available on this host: a call target becomes a
+// *types.Func, a type position becomes a *types.TypeName, and a plain value
+// reference becomes a *types.Var.
+func TestStubImporterClassifiesIdentifierKinds(t *testing.T) {
+	const src = `package main
+
+import unavailable "example.com/unavailable"
+
+func use() {
+	var v unavailable.Config
+	unavailable.Run()
+	var x unavailable.Counter
+	_ = v
+	_ = x
+	_ = unavailable.Version
+}
+`
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "use.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	refs := selectorIdentsFor([]*ast.File{file}, "unavailable")
+
+	wantKind := map[string]identKind{
+		"Config":  identKindType,
+		"Run":     identKindFunc,
+		"Counter": identKindType,
+		"Version": identKindValue,
+	}
+	gotKind := make(map[string]identKind, len(refs))
+	for _, ref := range refs {
+		gotKind[ref.ident.Name] = ref.kind
+	}
+	for name, want := range wantKind {
+		got, ok := gotKind[name]
+		if !ok {
+			t.Errorf("selectorIdentsFor: missing reference to %q", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("selectorIdentsFor(%q) kind = %v, want %v", name, got, want)
+		}
+	}
+
+	pkg := types.NewPackage("example.com/unavailable", "unavailable")
+	for _, ref := range refs {
+		obj := stubObjectFor(pkg, ref)
+		switch ref.ident.Name {
+		case "Config", "Counter":
+			if _, ok := obj.(*types.TypeName); !ok {
+				t.Errorf("stubObjectFor(%s) = %T, want *types.TypeName", ref.ident.Name, obj)
+			}
+		case "Run":
+			if _, ok := obj.(*types.Func); !ok {
+				t.Errorf("stubObjectFor(%s) = %T, want *types.Func", ref.ident.Name, obj)
+			}
+		case "Version":
+			if _, ok := obj.(*types.Var); !ok {
+				t.Errorf("stubObjectFor(%s) = %T, want *types.Var", ref.ident.Name, obj)
+			}
+		}
+	}
+}
+
+// TestCloseReleasesPerContextState checks that Close actually drops ctx's
+// entries from both typeCheckByCtx and multiPackageByCtx, rather than
+// leaving them retained (along with the *types.Info they hold onto) for
+// the rest of the process.
+func TestCloseReleasesPerContextState(t *testing.T) {
+	const src = `package main
+
+func main() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	ctx := new(TranslationContext)
+	ctx.AddPackage("example.com/main", "main.go")
+	if _, err := ctx.Check(fset, "example.com/main", []*ast.File{file}); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if ctx.TypeInfo() == nil {
+		t.Fatal("expected TypeInfo to be populated before Close")
+	}
+	if ctx.PackagePrefix("example.com/main") == "" {
+		t.Fatal("expected PackagePrefix to be populated before Close")
+	}
+
+	ctx.Close()
+
+	if ctx.TypeInfo() != nil {
+		t.Error("expected TypeInfo to be nil after Close")
+	}
+	if prefix := ctx.PackagePrefix("example.com/main"); prefix != "" {
+		t.Errorf("expected PackagePrefix to be empty after Close, got %q", prefix)
+	}
+}